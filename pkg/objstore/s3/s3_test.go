@@ -0,0 +1,86 @@
+package s3
+
+import (
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v6"
+)
+
+func TestNewCredentialsSTS(t *testing.T) {
+	conf := &Config{
+		CredentialsSource: "sts",
+		STSEndpoint:       "https://sts.amazonaws.com",
+		RoleARN:           "arn:aws:iam::123456789012:role/thanos",
+		AccessKey:         "key",
+		SecretKey:         "secret",
+	}
+	creds, err := newCredentials(conf)
+	if err != nil {
+		t.Fatalf("newCredentials: %v", err)
+	}
+	if creds == nil {
+		t.Fatal("expected non-nil credentials for the sts source")
+	}
+
+	if _, err := newCredentials(&Config{CredentialsSource: "sts"}); err == nil {
+		t.Fatal("expected an error when credentials_source is \"sts\" without role_arn")
+	}
+
+	if _, err := newCredentials(&Config{
+		CredentialsSource: "sts",
+		STSEndpoint:       "https://sts.amazonaws.com",
+		RoleARN:           "arn:aws:iam::123456789012:role/thanos",
+	}); err == nil {
+		t.Fatal("expected an error when the sts AssumeRole path is missing access_key/secret_key")
+	}
+}
+
+func TestConfigValidateObjectLock(t *testing.T) {
+	conf := Config{
+		Bucket:    "bucket",
+		Endpoint:  "endpoint",
+		AccessKey: "key",
+		SecretKey: "secret",
+		ObjectLock: ObjectLockConfig{
+			Mode: "GOVERNANCE",
+		},
+	}
+	if err := conf.Validate(); err == nil {
+		t.Fatal("expected an error when object_lock.mode is set without object_lock.retain_days")
+	}
+
+	conf.ObjectLock.RetainDays = 30
+	if err := conf.Validate(); err != nil {
+		t.Fatalf("unexpected error once object_lock.retain_days is set: %v", err)
+	}
+
+	conf.ObjectLock.Mode = "governance"
+	if err := conf.Validate(); err == nil {
+		t.Fatal("expected an error for an object_lock.mode value outside GOVERNANCE/COMPLIANCE")
+	}
+}
+
+func TestRetentionBlocksDelete(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	for name, tc := range map[string]struct {
+		retainUntil *time.Time
+		legalHold   minio.LegalHoldStatus
+		blocked     bool
+	}{
+		"no retention, no legal hold": {},
+		"legal hold enabled":          {legalHold: minio.LegalHoldEnabled, blocked: true},
+		"legal hold disabled":         {legalHold: minio.LegalHoldDisabled},
+		"retention in the future":     {retainUntil: &future, blocked: true},
+		"retention expired":           {retainUntil: &past},
+		"expired retention, held":     {retainUntil: &past, legalHold: minio.LegalHoldEnabled, blocked: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if got := retentionBlocksDelete(tc.retainUntil, tc.legalHold); got != tc.blocked {
+				t.Errorf("retentionBlocksDelete(%v, %q) = %v, want %v", tc.retainUntil, tc.legalHold, got, tc.blocked)
+			}
+		})
+	}
+}